@@ -0,0 +1,31 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/Matir/webborer/workqueue"
+	"net/url"
+)
+
+// InstrumentAdder wraps adder so that every URL it queues is reflected in
+// the webborer_queue_depth gauge.
+func InstrumentAdder(adder workqueue.QueueAddFunc) workqueue.QueueAddFunc {
+	return func(urls ...*url.URL) {
+		if len(urls) > 0 {
+			QueueChanged(len(urls))
+		}
+		adder(urls...)
+	}
+}
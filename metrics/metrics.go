@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exposes scan progress and worker statistics as
+// Prometheus metrics, so a long-running scan in a container can be
+// observed without tailing logs.  Instrumentation calls are safe to make
+// whether or not a Server is running; they only cost an in-memory
+// counter update.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// RequestsTotal counts every request issued, regardless of outcome.
+	RequestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webborer_requests_total",
+		Help: "Total number of HTTP requests issued.",
+	})
+	// ResponsesByStatus counts responses received, by status code.
+	ResponsesByStatus = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webborer_responses_total",
+		Help: "Total number of HTTP responses received, by status code.",
+	}, []string{"code"})
+	// BytesDownloaded counts total response bytes read.
+	BytesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webborer_bytes_downloaded_total",
+		Help: "Total number of response bytes downloaded.",
+	})
+	// QueueDepth is the current number of URLs waiting to be crawled.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "webborer_queue_depth",
+		Help: "Current number of URLs queued for crawling.",
+	})
+	// WorkersInFlight is the current number of workers actively handling
+	// a request.
+	WorkersInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "webborer_workers_in_flight",
+		Help: "Current number of workers actively handling a request.",
+	})
+	// ErrorsByScope counts request errors, by scope.
+	ErrorsByScope = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webborer_errors_total",
+		Help: "Total number of request errors, by scope.",
+	}, []string{"scope"})
+	// RequestDuration is a histogram of request latencies.
+	RequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "webborer_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		RequestsTotal,
+		ResponsesByStatus,
+		BytesDownloaded,
+		QueueDepth,
+		WorkersInFlight,
+		ErrorsByScope,
+		RequestDuration,
+	)
+}
+
+// RequestStarted records that a request is about to be issued, returning
+// a function to call with the outcome once it completes.
+func RequestStarted() func(statusCode int, bytes int64) {
+	RequestsTotal.Inc()
+	WorkersInFlight.Inc()
+	start := time.Now()
+	return func(statusCode int, bytes int64) {
+		WorkersInFlight.Dec()
+		RequestDuration.Observe(time.Since(start).Seconds())
+		if statusCode > 0 {
+			ResponsesByStatus.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		}
+		if bytes > 0 {
+			BytesDownloaded.Add(float64(bytes))
+		}
+	}
+}
+
+// RecordError records a request error for scope.
+func RecordError(scope string) {
+	ErrorsByScope.WithLabelValues(scope).Inc()
+}
+
+// QueueChanged adjusts the queue depth gauge by delta (positive for
+// additions, negative for removals/dequeues).
+func QueueChanged(delta int) {
+	QueueDepth.Add(float64(delta))
+}
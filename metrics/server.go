@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ScopeProgress is a snapshot of where a scan scope stands, as reported
+// by /debug/state.
+type ScopeProgress struct {
+	Scope     string `json:"scope"`
+	Queued    int64  `json:"queued"`
+	Completed int64  `json:"completed"`
+	Errors    int64  `json:"errors"`
+}
+
+// Server serves /metrics, /healthz, and /debug/state over HTTP, so a
+// long-running scan can be observed without tailing logs.
+type Server struct {
+	srv *http.Server
+
+	mu     sync.Mutex
+	scopes map[string]*ScopeProgress
+}
+
+// NewServer constructs a Server bound to addr.  It does not start
+// listening until Start is called.
+func NewServer(addr string) *Server {
+	s := &Server{scopes: map[string]*ScopeProgress{}}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/debug/state", s.handleDebugState)
+	s.srv = &http.Server{Addr: addr, Handler: mux}
+
+	return s
+}
+
+// Start begins serving in the background.  Errors after the listener is
+// established (e.g. the server being shut down) are not returned.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	go s.srv.Serve(ln)
+	return nil
+}
+
+// Stop closes the server immediately, dropping any active connections.
+func (s *Server) Stop() error {
+	return s.srv.Close()
+}
+
+// SetScopeProgress records the current progress for scope, overwriting
+// any previous snapshot.
+func (s *Server) SetScopeProgress(p ScopeProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scopes[p.Scope] = &p
+}
+
+// RemoveScope drops scope from the reported state, once it has finished.
+func (s *Server) RemoveScope(scope string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scopes, scope)
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	snapshot := make([]*ScopeProgress, 0, len(s.scopes))
+	for _, p := range s.scopes {
+		snapshot = append(snapshot, p)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
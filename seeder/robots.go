@@ -0,0 +1,137 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seeder fetches robots.txt and sitemap.xml for a scan's scopes
+// and feeds the URLs they reveal into the work queue, so a scan started
+// with settings.SeedRobots finds content a wordlist alone would miss.
+package seeder
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Rules holds the Allow/Disallow rules parsed out of a robots.txt for a
+// particular user agent, plus any Sitemap: directives it listed.
+type Rules struct {
+	allow    []string
+	disallow []string
+	Sitemaps []string
+}
+
+// Allowed reports whether path may be fetched under these rules.  As with
+// most robots.txt implementations, the longest matching rule wins, with
+// Allow breaking ties in favor of the crawler.
+func (r *Rules) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	bestLen := -1
+	bestAllow := true
+	check := func(patterns []string, allow bool) {
+		for _, pattern := range patterns {
+			if !strings.HasPrefix(path, pattern) {
+				continue
+			}
+			if len(pattern) > bestLen || (allow && len(pattern) == bestLen) {
+				bestLen = len(pattern)
+				bestAllow = allow
+			}
+		}
+	}
+	check(r.disallow, false)
+	check(r.allow, true)
+	return bestAllow
+}
+
+// ParseRobots parses a robots.txt document, keeping only the rules that
+// apply to userAgent (falling back to "*" groups when no group names
+// userAgent specifically).
+func ParseRobots(body io.Reader, userAgent string) *Rules {
+	rules := &Rules{}
+	userAgent = strings.ToLower(userAgent)
+
+	// Rules for "*" and for userAgent are gathered separately, so the "*"
+	// group only applies when no group names userAgent.
+	star, specific := &Rules{}, &Rules{}
+	var current *Rules
+	scanner := bufio.NewScanner(body)
+	sawSpecific := false
+	for scanner.Scan() {
+		line := stripComment(scanner.Text())
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		field, value, ok := splitDirective(line)
+		if !ok {
+			continue
+		}
+		switch field {
+		case "user-agent":
+			ua := strings.ToLower(value)
+			if ua == "*" {
+				current = star
+			} else if ua == userAgent {
+				current = specific
+				sawSpecific = true
+			} else {
+				current = nil
+			}
+		case "allow":
+			if current != nil && value != "" {
+				current.allow = append(current.allow, value)
+			}
+		case "disallow":
+			if current != nil && value != "" {
+				current.disallow = append(current.disallow, value)
+			}
+		case "sitemap":
+			if value != "" {
+				rules.Sitemaps = append(rules.Sitemaps, value)
+			}
+		}
+	}
+	chosen := star
+	if sawSpecific {
+		chosen = specific
+	}
+	rules.allow, rules.disallow = chosen.allow, chosen.disallow
+	return rules
+}
+
+func stripComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func splitDirective(line string) (field, value string, ok bool) {
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1]), true
+}
+
+// RobotsURL returns the robots.txt URL for scope.
+func RobotsURL(scope *url.URL) *url.URL {
+	u := *scope
+	u.Path = "/robots.txt"
+	u.RawQuery = ""
+	return &u
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seeder
+
+import (
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/workqueue"
+	"net/url"
+)
+
+// Seed fetches robots.txt for scope (when settings.Robots.Mode is
+// ObeyRobots or SeedRobots) and follows settings.Robots.ExtraSitemaps
+// regardless of Mode, plus, when settings.Robots.Mode is SeedRobots, the
+// robots.txt's own Sitemap: directives, feeding every URL it discovers
+// to adder via the same queue-add function passed to worker.NewWorker.
+// It returns the parsed Rules so the caller can have workers enforce
+// them (workers do so when settings.Robots.Mode is ObeyRobots or
+// SeedRobots).  Seeding is capped at
+// settings.Robots.MaxSeedURLs total and settings.Robots.MaxSitemapDepth
+// levels of sitemap index recursion.
+func Seed(ss *settings.ScanSettings, scope *url.URL, cf client.ClientFactory, adder workqueue.QueueAddFunc) *Rules {
+	if ss.Robots.Mode == settings.IgnoreRobots && len(ss.Robots.ExtraSitemaps) == 0 {
+		return nil
+	}
+
+	c := cf.Get()
+	budget := ss.Robots.MaxSeedURLs
+
+	var rules *Rules
+	if ss.Robots.Mode != settings.IgnoreRobots {
+		rules = fetchRobots(c, scope, ss.Network.UserAgent)
+	}
+
+	sitemaps := append([]string{}, ss.Robots.ExtraSitemaps...)
+	if ss.Robots.Mode == settings.SeedRobots && rules != nil {
+		sitemaps = append(sitemaps, rules.Sitemaps...)
+	}
+	if len(sitemaps) == 0 {
+		return rules
+	}
+
+	found := make([]*url.URL, 0, budget)
+	add := func(loc string) bool {
+		if len(found) >= budget {
+			return false
+		}
+		u, err := url.Parse(loc)
+		if err != nil {
+			logging.Logf(logging.LogInfo, "Seeder: bad URL %q: %s", loc, err.Error())
+			return true
+		}
+		found = append(found, scope.ResolveReference(u))
+		return true
+	}
+
+	seen := map[string]bool{}
+	for _, sm := range sitemaps {
+		seedSitemap(c, sm, 0, ss.Robots.MaxSitemapDepth, seen, add)
+		if len(found) >= budget {
+			break
+		}
+	}
+
+	if len(found) > 0 {
+		adder(found...)
+	}
+	return rules
+}
+
+func fetchRobots(c client.Client, scope *url.URL, userAgent string) *Rules {
+	resp, err := c.Get(RobotsURL(scope).String())
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Seeder: unable to fetch robots.txt for %s: %s", scope.String(), err.Error())
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil
+	}
+	return ParseRobots(resp.Body, userAgent)
+}
+
+// seedSitemap fetches a single sitemap URL, adding any URLs it lists via
+// add and recursing into any child sitemaps it points to, up to
+// maxDepth.  seen prevents re-fetching the same sitemap twice.
+func seedSitemap(c client.Client, sitemapURL string, depth, maxDepth int, seen map[string]bool, add func(string) bool) {
+	if depth > maxDepth || seen[sitemapURL] {
+		return
+	}
+	seen[sitemapURL] = true
+
+	resp, err := c.Get(sitemapURL)
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Seeder: unable to fetch sitemap %s: %s", sitemapURL, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return
+	}
+
+	urls, children, err := ParseSitemap(resp.Body, isGzipPath(sitemapURL))
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Seeder: unable to parse sitemap %s: %s", sitemapURL, err.Error())
+		return
+	}
+
+	for _, u := range urls {
+		if !add(u) {
+			return
+		}
+	}
+	for _, child := range children {
+		seedSitemap(c, child, depth+1, maxDepth, seen, add)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seeder
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// sitemapIndex is a <sitemapindex> document, which lists further
+// sitemaps rather than URLs directly.
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// urlSet is a <urlset> document, listing the URLs themselves.
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// ParseSitemap decodes a sitemap document (optionally gzip-compressed,
+// as indicated by gzipped), returning the URLs it lists directly and any
+// child sitemaps it points to (from a sitemap index) separately so the
+// caller can decide whether to recurse.
+func ParseSitemap(body io.Reader, gzipped bool) (urls []string, children []string, err error) {
+	if gzipped {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := readAllLimited(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(data, &index); err == nil && len(index.Sitemaps) > 0 {
+		for _, s := range index.Sitemaps {
+			children = append(children, strings.TrimSpace(s.Loc))
+		}
+		return nil, children, nil
+	}
+
+	var set urlSet
+	if err := xml.Unmarshal(data, &set); err != nil {
+		return nil, nil, err
+	}
+	for _, u := range set.URLs {
+		urls = append(urls, strings.TrimSpace(u.Loc))
+	}
+	return urls, nil, nil
+}
+
+// maxSitemapBytes bounds how much of a single sitemap document is read,
+// since hostile targets could otherwise serve an unbounded response.
+const maxSitemapBytes = 64 * 1024 * 1024
+
+func readAllLimited(r io.Reader) ([]byte, error) {
+	limited := io.LimitReader(r, maxSitemapBytes)
+	var b strings.Builder
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := limited.Read(buf)
+		if n > 0 {
+			b.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// isGzipPath reports whether a sitemap URL looks like a gzip-compressed
+// sitemap by its extension.
+func isGzipPath(loc string) bool {
+	return strings.HasSuffix(strings.ToLower(loc), ".gz")
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seeder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSitemap_TrimsLocWhitespace(t *testing.T) {
+	doc := "<urlset>\n" +
+		"<url><loc>\n  https://example.com/a\n</loc></url>\n" +
+		"<url><loc>https://example.com/b</loc></url>\n" +
+		"</urlset>"
+	urls, children, err := ParseSitemap(strings.NewReader(doc), false)
+	if err != nil {
+		t.Fatalf("ParseSitemap: %s", err.Error())
+	}
+	if len(children) != 0 {
+		t.Errorf("Expected no child sitemaps, got %v", children)
+	}
+	want := []string{"https://example.com/a", "https://example.com/b"}
+	if len(urls) != len(want) {
+		t.Fatalf("Expected %d URLs, got %v", len(want), urls)
+	}
+	for i, u := range urls {
+		if u != want[i] {
+			t.Errorf("URL %d: expected %q, got %q", i, want[i], u)
+		}
+	}
+}
+
+func TestParseSitemap_TrimsIndexLocWhitespace(t *testing.T) {
+	doc := "<sitemapindex>\n" +
+		"<sitemap><loc>\n  https://example.com/sitemap-a.xml\n</loc></sitemap>\n" +
+		"</sitemapindex>"
+	urls, children, err := ParseSitemap(strings.NewReader(doc), false)
+	if err != nil {
+		t.Fatalf("ParseSitemap: %s", err.Error())
+	}
+	if len(urls) != 0 {
+		t.Errorf("Expected no direct URLs, got %v", urls)
+	}
+	if len(children) != 1 || children[0] != "https://example.com/sitemap-a.xml" {
+		t.Errorf("Expected one trimmed child sitemap, got %v", children)
+	}
+}
@@ -0,0 +1,486 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/Matir/webborer/logging"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigError describes a problem with a single setting, identifying where
+// the offending value came from (a config file path or an environment
+// variable) so the user can find and fix it quickly.  Invalid flag values
+// are not reported as ConfigErrors; the flag package reports those itself.
+type ConfigError struct {
+	// Source is a human-readable description of where the value came
+	// from, e.g. "config file /etc/webborer.conf" or "environment variable
+	// WEBBORER_SPIDER_MANGLE".
+	Source string
+	// Key is the dotted setting name, e.g. "spider.spider_codes".
+	Key string
+	// Err is the underlying parse/validation error.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Source, e.Key, e.Err.Error())
+}
+
+// settingsGroups lists the named sub-structs that make up ScanSettings, in
+// the order their fields should be documented and written out.  A group
+// listed here (and mapped to its sub-struct in groupValue and
+// GenerateExampleConfig) is read from config files and environment
+// variables and written by -dump-config.
+var settingsGroups = []string{"network", "output", "spider", "robots", "state", "soft404"}
+
+// groupValue returns the reflect.Value of the named sub-struct (e.g.
+// "network" -> &settings.Network) and the addressable top-level struct
+// otherwise (for ungrouped fields like queue_size).
+func (settings *ScanSettings) groupValue(group string) reflect.Value {
+	v := reflect.ValueOf(settings).Elem()
+	switch group {
+	case "network":
+		return v.FieldByName("Network")
+	case "output":
+		return v.FieldByName("Output")
+	case "spider":
+		return v.FieldByName("Spider")
+	case "robots":
+		return v.FieldByName("Robots")
+	case "state":
+		return v.FieldByName("State")
+	case "soft404":
+		return v.FieldByName("Soft404")
+	default:
+		return v
+	}
+}
+
+// fieldByConfigName finds the struct field within group tagged with the
+// given config name.
+func fieldByConfigName(groupVal reflect.Value, name string) (reflect.Value, reflect.StructField, bool) {
+	t := groupVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("config") == name {
+			return groupVal.Field(i), f, true
+		}
+	}
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+// setFieldFromString applies a raw string value (from an env var or config
+// scalar) to a struct field, converting it to the field's type.
+func setFieldFromString(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		if field.Type() == reflect.TypeOf(RobotsMode(0)) {
+			mode, err := ParseRobotsMode(raw)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(mode))
+			return nil
+		}
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Slice:
+		parts := strings.Split(raw, ",")
+		return setFieldFromStrings(field, parts)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Kind())
+	}
+	return nil
+}
+
+// setFieldFromStrings applies a slice of raw strings to a []string or []int
+// field.
+func setFieldFromStrings(field reflect.Value, raw []string) error {
+	switch field.Type().Elem().Kind() {
+	case reflect.String:
+		field.Set(reflect.ValueOf(append([]string{}, raw...)))
+	case reflect.Int:
+		ints := make([]int, 0, len(raw))
+		for _, v := range raw {
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("unable to parse %q as int: %s", v, err.Error())
+			}
+			ints = append(ints, i)
+		}
+		field.Set(reflect.ValueOf(ints))
+	default:
+		return fmt.Errorf("unsupported slice element type %s", field.Type().Elem().Kind())
+	}
+	return nil
+}
+
+// setFieldFromValue applies a decoded config value (as produced by a YAML
+// or TOML unmarshal into interface{}) to a struct field.
+func setFieldFromValue(field reflect.Value, raw interface{}) error {
+	switch v := raw.(type) {
+	case string:
+		return setFieldFromString(field, v)
+	case bool:
+		if field.Kind() != reflect.Bool {
+			return fmt.Errorf("expected %s, got bool", field.Kind())
+		}
+		field.SetBool(v)
+	case int:
+		return setFieldFromString(field, strconv.Itoa(v))
+	case int64:
+		return setFieldFromString(field, strconv.FormatInt(v, 10))
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i, item := range v {
+			strs[i] = fmt.Sprintf("%v", item)
+		}
+		return setFieldFromStrings(field, strs)
+	default:
+		return setFieldFromString(field, fmt.Sprintf("%v", v))
+	}
+	return nil
+}
+
+// applyGroupMap applies a decoded map of config-name -> value onto the
+// named group (or the top-level struct, for group == "").
+func (settings *ScanSettings) applyGroupMap(group string, data map[interface{}]interface{}, source string) error {
+	groupVal := settings.groupValue(group)
+	for k, v := range data {
+		name, ok := k.(string)
+		if !ok {
+			continue
+		}
+		field, _, found := fieldByConfigName(groupVal, name)
+		if !found {
+			key := name
+			if group != "" {
+				key = group + "." + name
+			}
+			return &ConfigError{Source: source, Key: key, Err: fmt.Errorf("unknown setting")}
+		}
+		if err := setFieldFromValue(field, v); err != nil {
+			key := name
+			if group != "" {
+				key = group + "." + name
+			}
+			return &ConfigError{Source: source, Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+// normalizeMap converts the map[interface{}]interface{} produced by YAML
+// (and the map[string]interface{} produced by TOML) into a single
+// map[interface{}]interface{} shape so the rest of the merge logic only
+// has to handle one type.
+func normalizeMap(raw interface{}) map[interface{}]interface{} {
+	switch m := raw.(type) {
+	case map[interface{}]interface{}:
+		return m
+	case map[string]interface{}:
+		out := make(map[interface{}]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// decodeConfigContents parses contents as YAML or TOML, chosen by path's
+// extension (.yaml/.yml for YAML, .toml for TOML).  Any other extension
+// is sniffed: it's decoded as YAML, falling back to TOML if that fails,
+// so the .conf files in defaultConfigPaths work without users having to
+// rename them.
+func decodeConfigContents(path string, contents []byte) (map[string]interface{}, error) {
+	decoded := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(contents, &decoded); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(contents), &decoded); err != nil {
+			return nil, err
+		}
+	default:
+		if yamlErr := yaml.Unmarshal(contents, &decoded); yamlErr != nil {
+			decoded = map[string]interface{}{}
+			if _, tomlErr := toml.Decode(string(contents), &decoded); tomlErr != nil {
+				return nil, fmt.Errorf("unable to parse as YAML (%s) or TOML (%s)", yamlErr.Error(), tomlErr.Error())
+			}
+		}
+	}
+	return decoded, nil
+}
+
+// LoadFromConfigFile loads settings from the given file, merging them on
+// top of whatever is already present (typically the built-in defaults).
+// The format is chosen by file extension: .yaml/.yml for YAML, .toml for
+// TOML.  Any other extension, including the .conf used by the default
+// config paths in defaultConfigPaths, is sniffed: it's parsed as YAML,
+// falling back to TOML if that fails.
+func (settings *ScanSettings) LoadFromConfigFile(path string) error {
+	settings.InitFlags()
+	source := fmt.Sprintf("config file %s", path)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &ConfigError{Source: source, Key: "", Err: err}
+	}
+
+	decoded, err := decodeConfigContents(path, contents)
+	if err != nil {
+		return &ConfigError{Source: source, Key: "", Err: err}
+	}
+	raw := normalizeMap(decoded)
+
+	for _, group := range settingsGroups {
+		sub, ok := raw[group]
+		if !ok {
+			continue
+		}
+		groupMap := normalizeMap(sub)
+		if groupMap == nil {
+			return &ConfigError{Source: source, Key: group, Err: fmt.Errorf("expected a mapping")}
+		}
+		if err := settings.applyGroupMap(group, groupMap, source); err != nil {
+			return err
+		}
+		delete(raw, group)
+	}
+	// Whatever's left applies to the top-level (ungrouped) settings.
+	if err := settings.applyGroupMap("", raw, source); err != nil {
+		return err
+	}
+
+	settings.configPath = path
+	return nil
+}
+
+// findConfigPath returns the config file to load: the explicit -config
+// flag value if one was given, otherwise the first file found among
+// defaultConfigPaths.  Must be called after flags are parsed.
+func (settings *ScanSettings) findConfigPath() string {
+	if settings.ConfigPath != "" {
+		return settings.ConfigPath
+	}
+	for _, path := range defaultConfigPaths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load settings from the first file found in defaultConfigPaths.  Retained
+// for compatibility with callers that want default-only behavior without
+// checking -config; GetScanSettings uses findConfigPath/LoadFromConfigFile
+// directly so -config can override the search.
+func (settings *ScanSettings) LoadFromDefaultConfigFiles() {
+	for _, path := range defaultConfigPaths {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		if err := settings.LoadFromConfigFile(path); err != nil {
+			logging.Logf(logging.LogError, "Error loading config file %s: %s", path, err.Error())
+		}
+		return
+	}
+}
+
+// envPrefix is prepended to all environment variable names webborer
+// recognizes, e.g. WEBBORER_SPIDER_MANGLE.
+const envPrefix = "WEBBORER_"
+
+// LoadFromEnvironment merges in any settings expressed as environment
+// variables, named WEBBORER_<GROUP>_<FIELD> for grouped settings (e.g.
+// WEBBORER_SPIDER_MANGLE) or WEBBORER_<FIELD> for top-level settings (e.g.
+// WEBBORER_QUEUE_SIZE).  It must run after config file loading and before
+// flag parsing so flags retain the highest precedence.
+func (settings *ScanSettings) LoadFromEnvironment() error {
+	apply := func(group string) error {
+		groupVal := settings.groupValue(group)
+		t := groupVal.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("config")
+			if name == "" {
+				continue
+			}
+			envName := envPrefix + strings.ToUpper(name)
+			if group != "" {
+				envName = envPrefix + strings.ToUpper(group) + "_" + strings.ToUpper(name)
+			}
+			raw, ok := os.LookupEnv(envName)
+			if !ok {
+				continue
+			}
+			if err := setFieldFromString(groupVal.Field(i), raw); err != nil {
+				key := name
+				if group != "" {
+					key = group + "." + name
+				}
+				return &ConfigError{Source: "environment variable " + envName, Key: key, Err: err}
+			}
+		}
+		return nil
+	}
+	if err := apply(""); err != nil {
+		return err
+	}
+	for _, group := range settingsGroups {
+		if err := apply(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpValue returns field's value in the same textual form
+// setFieldFromString expects back, so DumpConfig's output round-trips
+// through LoadFromConfigFile: time.Duration and RobotsMode are formatted
+// as strings rather than their raw underlying integers.
+func dumpValue(field reflect.Value) interface{} {
+	switch v := field.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case RobotsMode:
+		return robotsModeStrings[v]
+	default:
+		return v
+	}
+}
+
+// DumpConfig writes the effective, fully-merged settings (defaults,
+// config file, environment and flags all applied) to path as YAML, in the
+// same grouped shape LoadFromConfigFile reads.
+func (settings *ScanSettings) DumpConfig(path string) error {
+	out := map[string]interface{}{}
+	collect := func(group string) map[string]interface{} {
+		groupVal := settings.groupValue(group)
+		t := groupVal.Type()
+		m := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			name := t.Field(i).Tag.Get("config")
+			if name == "" {
+				continue
+			}
+			m[name] = dumpValue(groupVal.Field(i))
+		}
+		return m
+	}
+	for k, v := range collect("") {
+		out[k] = v
+	}
+	for _, group := range settingsGroups {
+		out[group] = collect(group)
+	}
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// GenerateExampleConfig returns a YAML document listing every available
+// setting with its default value and a comment describing it, suitable
+// for writing out as a starting point for a user's config file.
+func GenerateExampleConfig() string {
+	var b strings.Builder
+	emit := func(group string, t reflect.Type, indent string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("config")
+			if name == "" {
+				continue
+			}
+			doc := f.Tag.Get("doc")
+			def := f.Tag.Get("default")
+			if doc != "" {
+				fmt.Fprintf(&b, "%s# %s (default: %s)\n", indent, doc, def)
+			}
+			fmt.Fprintf(&b, "%s#%s: %s\n", indent, name, def)
+		}
+	}
+	fmt.Fprintf(&b, "# webborer example config (all values shown commented out with defaults)\n")
+	// Ungrouped settings: walk the ScanSettings type directly for fields
+	// with a config tag.
+	ungrouped := reflect.TypeOf(ScanSettings{})
+	for i := 0; i < ungrouped.NumField(); i++ {
+		f := ungrouped.Field(i)
+		name := f.Tag.Get("config")
+		if name == "" {
+			continue
+		}
+		doc := f.Tag.Get("doc")
+		def := f.Tag.Get("default")
+		if doc != "" {
+			fmt.Fprintf(&b, "# %s (default: %s)\n", doc, def)
+		}
+		fmt.Fprintf(&b, "#%s: %s\n", name, def)
+	}
+	for _, group := range settingsGroups {
+		fmt.Fprintf(&b, "\n%s:\n", group)
+		var t reflect.Type
+		switch group {
+		case "network":
+			t = reflect.TypeOf(NetworkSettings{})
+		case "output":
+			t = reflect.TypeOf(OutputSettings{})
+		case "spider":
+			t = reflect.TypeOf(SpiderSettings{})
+		case "robots":
+			t = reflect.TypeOf(RobotsSettings{})
+		case "state":
+			t = reflect.TypeOf(StateSettings{})
+		case "soft404":
+			t = reflect.TypeOf(Soft404Settings{})
+		}
+		emit(group, t, "  ")
+	}
+	return b.String()
+}
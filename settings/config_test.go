@@ -0,0 +1,93 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTempConfig(t *testing.T, name, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "webborer-config-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	return path
+}
+
+// newTestSettings returns a ScanSettings with flagsSet already true, so
+// LoadFromConfigFile's call to InitFlags is a no-op: tests can load
+// config files without touching the process-global flag.CommandLine.
+func newTestSettings() *ScanSettings {
+	return &ScanSettings{flagsSet: true}
+}
+
+func TestLoadFromConfigFile_DotConfSniffsYAML(t *testing.T) {
+	path := writeTempConfig(t, "webborer.conf", "robots:\n  robots_mode: obey\n")
+	ss := newTestSettings()
+	if err := ss.LoadFromConfigFile(path); err != nil {
+		t.Fatalf("LoadFromConfigFile: %s", err.Error())
+	}
+	if ss.Robots.Mode != ObeyRobots {
+		t.Errorf("Expected Robots.Mode ObeyRobots, got %v", ss.Robots.Mode)
+	}
+}
+
+func TestLoadFromConfigFile_DotConfSniffsTOML(t *testing.T) {
+	path := writeTempConfig(t, "webborer.conf", "[robots]\nrobots_mode = \"seed\"\n")
+	ss := newTestSettings()
+	if err := ss.LoadFromConfigFile(path); err != nil {
+		t.Fatalf("LoadFromConfigFile: %s", err.Error())
+	}
+	if ss.Robots.Mode != SeedRobots {
+		t.Errorf("Expected Robots.Mode SeedRobots, got %v", ss.Robots.Mode)
+	}
+}
+
+func TestDumpConfig_RoundTrip(t *testing.T) {
+	ss := newTestSettings()
+	ss.Network.Timeout = 45 * time.Second
+	ss.Robots.Mode = SeedRobots
+
+	dir, err := ioutil.TempDir("", "webborer-dump-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "webborer.yaml")
+	if err := ss.DumpConfig(path); err != nil {
+		t.Fatalf("DumpConfig: %s", err.Error())
+	}
+
+	reloaded := newTestSettings()
+	if err := reloaded.LoadFromConfigFile(path); err != nil {
+		t.Fatalf("LoadFromConfigFile of dumped config: %s", err.Error())
+	}
+	if reloaded.Network.Timeout != 45*time.Second {
+		t.Errorf("Expected Timeout 45s, got %s", reloaded.Network.Timeout)
+	}
+	if reloaded.Robots.Mode != SeedRobots {
+		t.Errorf("Expected Robots.Mode SeedRobots, got %v", reloaded.Robots.Mode)
+	}
+}
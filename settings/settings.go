@@ -29,62 +29,173 @@ import (
 )
 
 // ScanSettings store all of the settings for the running scan.  It's basically
-// a mapping from command-line flags into a single struct that can be passed
-// into setup functions to get the desired behavior.
+// a mapping from defaults, config files, environment variables and
+// command-line flags into a single struct that can be passed into setup
+// functions to get the desired behavior.  Settings are grouped into
+// sub-structs by area of concern; each field carries a `config` tag (the
+// name used in config files and environment variables) and a `doc` tag
+// (the text shown in generated example configs).  The -help text comes
+// from the flag definitions in InitFlags, not from these tags.
 type ScanSettings struct {
 	// Starting point and scope of scan
 	BaseURLs []string
+	// Networking related settings
+	Network NetworkSettings
+	// Output related settings
+	Output OutputSettings
+	// Spidering/crawling related settings
+	Spider SpiderSettings
+	// Robots.txt handling
+	Robots RobotsSettings
+	// Crawl state persistence, for pause/resume and diffing
+	State StateSettings
+	// Soft-404 / baseline response filtering
+	Soft404 Soft404Settings
+	// How long should internal queues be sized
+	QueueSize int `config:"queue_size" default:"1024" doc:"Depth of internal work queues."`
+	// Whether or not to do CPU Profiling
+	DebugCPUProf bool
+	// Address to bind the Prometheus /metrics, /healthz, and /debug/state
+	// HTTP server to, e.g. "localhost:9090".  Empty disables it.
+	MetricsAddr string `config:"metrics_addr" default:"" doc:"Address to serve Prometheus metrics and debug endpoints on (empty disables it)."`
+	// Path to a config file to load, overriding defaultConfigPaths
+	ConfigPath string
+	// If set, write the effective merged config to this path and continue
+	DumpConfigPath string
+	// Config file actually used when loading (for debugging only)
+	configPath string
+	// Have flags been set up?
+	flagsSet bool
+}
+
+// NetworkSettings groups the settings that control how webborer talks to
+// the network: concurrency, proxies, timeouts and the identity it
+// presents.
+type NetworkSettings struct {
 	// Number of threads to run
-	Threads int
+	Threads int `config:"threads" default:"runtime.NumCPU()" doc:"Number of worker threads."`
 	// Number of workers to run
-	Workers int
-	// Exclusions
-	ExcludePaths []string
+	Workers int `config:"workers" default:"2*runtime.NumCPU()" doc:"Number of workers."`
 	// Proxies
-	Proxies []string
-	// Parse HTML for links?
-	ParseHTML bool
+	Proxies []string `config:"proxies" default:"" doc:"Proxy or proxies to use."`
 	// Time to sleep between requests, per thread
-	SleepTime time.Duration
+	SleepTime time.Duration `config:"sleep" default:"0" doc:"Time to sleep between requests, per thread."`
+	// Timeout for network requests
+	Timeout time.Duration `config:"timeout" default:"30s" doc:"Timeout for network requests."`
+	// User-Agent for requests
+	UserAgent string `config:"user_agent" default:"WebBorer 0.01" doc:"User-Agent for requests."`
+	// Whether to allow upgrade from http to https
+	AllowHTTPSUpgrade bool `config:"allow_upgrade" default:"false" doc:"Allow HTTP->HTTPS upgrades."`
+}
+
+// OutputSettings groups the settings that control where and how results
+// and logs are written.
+type OutputSettings struct {
 	// Log file path
-	LogfilePath string
+	LogfilePath string `config:"logfile" default:"" doc:"Logfile filename (defaults to stderr)."`
 	// Level of logging
-	LogLevel string
-	// Wordlist for scanning
-	WordlistPath string
-	// Extensions for mangling
-	Extensions []string
-	// Whether or not to mangle
-	Mangle bool
-	// How long should internal queues be sized
-	QueueSize int
-	// Timeout for network requests
-	Timeout time.Duration
+	LogLevel string `config:"loglevel" default:"WARNING" doc:"Log level."`
 	// Output type
-	OutputFormat string
+	Format string `config:"format" default:"" doc:"Output format."`
 	// Output path
-	OutputPath string
-	// User-Agent for requests
-	UserAgent string
+	Path string `config:"outfile" default:"" doc:"Output file, defaults to stdout."`
 	// Whether to include redirects in reporting
-	IncludeRedirects bool
-	// How to handle Robots.txt
-	RobotsMode int
-	// Whether to allow upgrade from http to https
-	AllowHTTPSUpgrade bool
+	IncludeRedirects bool `config:"include_redirects" default:"false" doc:"Include redirects in reports."`
+}
+
+// SpiderSettings groups the settings that control what webborer crawls
+// and how it mangles discovered paths.
+type SpiderSettings struct {
+	// Exclusions
+	ExcludePaths []string `config:"exclude" default:"" doc:"Paths to exclude from search."`
+	// Parse HTML for links?
+	ParseHTML bool `config:"html" default:"true" doc:"Parse HTML documents for links to follow."`
+	// Wordlist for scanning
+	WordlistPath string `config:"wordlist" default:"" doc:"Wordlist filename to use (default built-in)."`
+	// Extensions for mangling
+	Extensions []string `config:"extensions" default:"html,php,asp,aspx" doc:"Extensions to mangle with."`
+	// Whether or not to mangle
+	Mangle bool `config:"mangle" default:"true" doc:"Mangle by adding extensions."`
 	// Spider which http response codes
-	SpiderCodes []int
-	// Whether or not to do CPU Profiling
-	DebugCPUProf bool
-	// Config file used when loading (for debugging only)
-	configPath string
-	// Have flags been set up?
-	flagsSet bool
+	SpiderCodes []int `config:"spider_codes" default:"200" doc:"HTTP response codes to continue spidering on."`
+	// Largest response body to parse for links, in bytes
+	MaxContentLength int64 `config:"max_content_length" default:"1048576" doc:"Maximum response body size, in bytes, to parse for links."`
+}
+
+// RobotsSettings groups the settings that control robots.txt handling.
+type RobotsSettings struct {
+	// How to handle Robots.txt
+	Mode RobotsMode `config:"robots_mode" default:"ignore" doc:"Robots mode: ignore, obey, or seed."`
+	// Additional sitemaps to seed explicitly, beyond any robots.txt points to
+	ExtraSitemaps []string `config:"sitemaps" default:"" doc:"Additional sitemap URLs to seed explicitly."`
+	// Maximum URLs to add to the queue while seeding from robots.txt/sitemaps
+	MaxSeedURLs int `config:"max_seed_urls" default:"10000" doc:"Maximum URLs to seed from robots.txt/sitemaps before stopping."`
+	// Maximum depth to recurse into sitemap indexes
+	MaxSitemapDepth int `config:"max_sitemap_depth" default:"5" doc:"Maximum sitemap index recursion depth."`
+}
+
+// StateSettings groups the settings that control persisting crawl state
+// to disk, so a scan can be paused, resumed, or diffed against a prior
+// run.
+type StateSettings struct {
+	// Path to the state database for this run.  If set, every URL
+	// queued/requested/completed is recorded here as the scan runs.
+	Path string `config:"path" default:"" doc:"State database path for this run."`
+	// Path to a previous state database to resume from: not-yet-completed
+	// URLs are requeued and the database is reused for this run.
+	ResumePath string `config:"resume" default:"" doc:"Prior state database to resume an interrupted scan from."`
+	// Path to a previous state database to diff against: only URLs whose
+	// response fingerprint changed are reported.
+	DiffPath string `config:"diff" default:"" doc:"Prior state database to diff this run's responses against."`
+}
+
+// Soft404Settings groups the settings that control detecting and
+// suppressing soft-404s: "not found" pages that respond 200 OK.
+type Soft404Settings struct {
+	// How aggressively to detect and suppress soft-404s: "auto", "off", or "strict"
+	Mode string `config:"mode" default:"auto" doc:"Soft-404 detection mode: auto, off, or strict."`
+	// Number of baseline probe requests (per extension) to issue per scope
+	Samples int `config:"samples" default:"5" doc:"Number of baseline probe requests, per extension, per scope."`
+}
+
+// Soft404 modes
+const (
+	Soft404Auto   = "auto"
+	Soft404Off    = "off"
+	Soft404Strict = "strict"
+)
+
+var soft404Modes = [...]string{Soft404Auto, Soft404Off, Soft404Strict}
+
+// soft404Flag is a Soft404Settings.Mode as a flag, restricted to the
+// known mode strings.
+type soft404Flag struct {
+	mode *string
+}
+
+func (f soft404Flag) String() string {
+	if f.mode == nil {
+		return Soft404Auto
+	}
+	return *f.mode
+}
+
+func (f soft404Flag) Set(value string) error {
+	for _, m := range soft404Modes {
+		if m == value {
+			*f.mode = value
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown soft-404 mode: %s", value)
 }
 
+// RobotsMode selects how webborer handles robots.txt.
+type RobotsMode int
+
 // We handle Robots.txt in various ways
 const (
-	IgnoreRobots = iota
+	IgnoreRobots RobotsMode = iota
 	ObeyRobots
 	SeedRobots
 	robotsModeMax
@@ -96,6 +207,18 @@ var robotsModeStrings = [...]string{
 	"seed",
 }
 
+// ParseRobotsMode converts one of robotsModeStrings ("ignore", "obey",
+// "seed") into a RobotsMode, for use by config files, environment
+// variables and flags alike.
+func ParseRobotsMode(value string) (RobotsMode, error) {
+	for i, val := range robotsModeStrings {
+		if val == value {
+			return RobotsMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown Robots Mode: %s", value)
+}
+
 var DefaultUserAgent = "WebBorer 0.01"
 var outputFormats []string
 
@@ -173,7 +296,7 @@ func (f DurationFlag) Set(value string) error {
 
 // RobotsFlag is a RobotsMode as a flag
 type robotsFlag struct {
-	mode *int
+	mode *RobotsMode
 }
 
 func (f robotsFlag) String() string {
@@ -184,37 +307,75 @@ func (f robotsFlag) String() string {
 }
 
 func (f robotsFlag) Set(value string) error {
-	for i, val := range robotsModeStrings {
-		if val == value {
-			*(f.mode) = i
-			return nil
-		}
+	mode, err := ParseRobotsMode(value)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("Unknown Robots Mode: %s", value)
+	*(f.mode) = mode
+	return nil
 }
 
 // Constructs a ScanSettings struct with all of the defaults to be used.
 func NewScanSettings() *ScanSettings {
 	settings := &ScanSettings{
-		Threads:     runtime.NumCPU(),
-		Extensions:  []string{"html", "php", "asp", "aspx"},
-		Mangle:      true,
-		QueueSize:   1024,
-		Timeout:     30 * time.Second,
-		LogLevel:    "WARNING",
-		SpiderCodes: []int{200},
+		Network: NetworkSettings{
+			Threads: runtime.NumCPU(),
+			Timeout: 30 * time.Second,
+		},
+		Output: OutputSettings{
+			LogLevel: "WARNING",
+		},
+		Spider: SpiderSettings{
+			Extensions:       []string{"html", "php", "asp", "aspx"},
+			Mangle:           true,
+			SpiderCodes:      []int{200},
+			MaxContentLength: 1024 * 1024,
+		},
+		Robots: RobotsSettings{
+			MaxSeedURLs:     10000,
+			MaxSitemapDepth: 5,
+		},
+		Soft404: Soft404Settings{
+			Mode:    Soft404Auto,
+			Samples: 5,
+		},
+		QueueSize: 1024,
 	}
 	settings.InitFlags()
 	return settings
 }
 
-// Create settings that includes configuration files and command line flags.
-// Generally, this should be called very early and is the best way to get the
-// settings.
+// Create settings that includes configuration files, environment variables
+// and command line flags.  Generally, this should be called very early and
+// is the best way to get the settings.
+//
+// Precedence, lowest to highest: built-in defaults < config file <
+// environment variables < command line flags.
 func GetScanSettings() (*ScanSettings, error) {
 	settings := NewScanSettings()
-	settings.LoadFromDefaultConfigFiles()
+
+	// Parse flags once up front so -config is known before the config file
+	// search; they are parsed again below so they take precedence.
+	flag.Parse()
+	configPath := settings.findConfigPath()
+	if configPath != "" {
+		if err := settings.LoadFromConfigFile(configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := settings.LoadFromEnvironment(); err != nil {
+		return nil, err
+	}
+
 	settings.ParseFlags()
+
+	if settings.DumpConfigPath != "" {
+		if err := settings.DumpConfig(settings.DumpConfigPath); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := settings.Validate(); err != nil {
 		return nil, err
 	}
@@ -229,37 +390,50 @@ func (settings *ScanSettings) InitFlags() {
 
 	baseUrlValue := StringSliceFlag{&settings.BaseURLs}
 	flag.Var(baseUrlValue, "url", "Starting `URL` & scopes.")
-	flag.IntVar(&settings.Threads, "threads", runtime.NumCPU(), "Number of worker `threads`.")
-	flag.IntVar(&settings.Workers, "workers", runtime.NumCPU()*2, "Number of `workers`.")
-	excludePathValue := StringSliceFlag{&settings.ExcludePaths}
+	flag.IntVar(&settings.Network.Threads, "threads", runtime.NumCPU(), "Number of worker `threads`.")
+	flag.IntVar(&settings.Network.Workers, "workers", runtime.NumCPU()*2, "Number of `workers`.")
+	excludePathValue := StringSliceFlag{&settings.Spider.ExcludePaths}
 	flag.Var(excludePathValue, "exclude", "List of `paths` to exclude from search.")
-	flag.BoolVar(&settings.ParseHTML, "html", true, "Parse HTML documents for links to follow.")
-	flag.BoolVar(&settings.AllowHTTPSUpgrade, "allow-upgrade", false, "Allow HTTP->HTTPS upgrades.")
-	sleepTimeValue := DurationFlag{&settings.SleepTime}
+	flag.BoolVar(&settings.Spider.ParseHTML, "html", true, "Parse HTML documents for links to follow.")
+	flag.BoolVar(&settings.Network.AllowHTTPSUpgrade, "allow-upgrade", false, "Allow HTTP->HTTPS upgrades.")
+	sleepTimeValue := DurationFlag{&settings.Network.SleepTime}
 	flag.Var(sleepTimeValue, "sleep", "Time (as `duration`) to sleep between requests.")
-	flag.StringVar(&settings.LogfilePath, "logfile", "", "Logfile `filename` (defaults to stderr)")
-	flag.StringVar(&settings.WordlistPath, "wordlist", "", "Wordlist `filename` to use (default built-in)")
-	extensionValue := StringSliceFlag{&settings.Extensions}
+	flag.StringVar(&settings.Output.LogfilePath, "logfile", "", "Logfile `filename` (defaults to stderr)")
+	flag.StringVar(&settings.Spider.WordlistPath, "wordlist", "", "Wordlist `filename` to use (default built-in)")
+	extensionValue := StringSliceFlag{&settings.Spider.Extensions}
 	flag.Var(extensionValue, "extensions", "List of `extensions` to mangle with.")
-	flag.BoolVar(&settings.Mangle, "mangle", true, "Mangle by adding extensions.")
-	proxyValue := StringSliceFlag{&settings.Proxies}
+	flag.BoolVar(&settings.Spider.Mangle, "mangle", true, "Mangle by adding extensions.")
+	proxyValue := StringSliceFlag{&settings.Network.Proxies}
 	flag.Var(proxyValue, "proxy", "Proxy or `proxies` to use.")
-	timeoutValue := DurationFlag{&settings.Timeout}
+	timeoutValue := DurationFlag{&settings.Network.Timeout}
 	flag.Var(timeoutValue, "timeout", "Network connection timeout (`duration`).")
 	if len(outputFormats) > 1 {
 		formatHelp := fmt.Sprintf("Output `format`.  Options: [%s]", strings.Join(outputFormats, ", "))
-		flag.StringVar(&settings.OutputFormat, "format", outputFormats[0], formatHelp)
+		flag.StringVar(&settings.Output.Format, "format", outputFormats[0], formatHelp)
 	}
-	flag.StringVar(&settings.OutputPath, "outfile", "", "Output `file`, defaults to stdout.")
+	flag.StringVar(&settings.Output.Path, "outfile", "", "Output `file`, defaults to stdout.")
 	loglevelHelp := fmt.Sprintf("Log `level`.  Options: [%s]", strings.Join(logging.LogLevelStrings[:], ", "))
-	flag.StringVar(&settings.LogLevel, "loglevel", settings.LogLevel, loglevelHelp)
-	flag.StringVar(&settings.UserAgent, "user-agent", DefaultUserAgent, "`User-Agent` for requests")
-	flag.BoolVar(&settings.IncludeRedirects, "include-redirects", false, "Include redirects in reports.")
+	flag.StringVar(&settings.Output.LogLevel, "loglevel", settings.Output.LogLevel, loglevelHelp)
+	flag.StringVar(&settings.Network.UserAgent, "user-agent", DefaultUserAgent, "`User-Agent` for requests")
+	flag.BoolVar(&settings.Output.IncludeRedirects, "include-redirects", false, "Include redirects in reports.")
 	robotsModeHelp := fmt.Sprintf("Robots `mode`.  Options: [%s]", strings.Join(robotsModeStrings[:], ", "))
-	robotsModeVar := robotsFlag{&settings.RobotsMode}
-	spiderCodesValue := IntSliceFlag{&settings.SpiderCodes}
+	robotsModeVar := robotsFlag{&settings.Robots.Mode}
+	spiderCodesValue := IntSliceFlag{&settings.Spider.SpiderCodes}
 	flag.Var(spiderCodesValue, "spider-codes", "HTTP Response Codes to Continue Spidering On.")
+	flag.Int64Var(&settings.Spider.MaxContentLength, "max-content-length", settings.Spider.MaxContentLength, "Maximum response body `size`, in bytes, to parse for links.")
 	flag.Var(robotsModeVar, "robots-mode", robotsModeHelp)
+	sitemapValue := StringSliceFlag{&settings.Robots.ExtraSitemaps}
+	flag.Var(sitemapValue, "sitemap", "Additional sitemap `URL`(s) to seed explicitly.")
+	flag.StringVar(&settings.ConfigPath, "config", "", "`Path` to a config file, overriding the default search paths.")
+	flag.StringVar(&settings.DumpConfigPath, "dump-config", "", "Write the effective merged config to `path` and continue.")
+	flag.StringVar(&settings.State.Path, "state", "", "State database `file` to record this scan's progress in.")
+	flag.StringVar(&settings.State.ResumePath, "resume", "", "State database `file` from a prior scan; requeue its incomplete URLs.")
+	flag.StringVar(&settings.State.DiffPath, "diff", "", "Prior state database `file` to diff this scan's responses against.")
+	soft404Help := fmt.Sprintf("Soft-404 detection `mode`.  Options: [%s]", strings.Join(soft404Modes[:], ", "))
+	soft404ModeVar := soft404Flag{&settings.Soft404.Mode}
+	flag.Var(soft404ModeVar, "soft404", soft404Help)
+	flag.IntVar(&settings.Soft404.Samples, "soft404-samples", settings.Soft404.Samples, "Number of baseline probe `requests`, per extension, per scope.")
+	flag.StringVar(&settings.MetricsAddr, "metrics-addr", "", "`Address` to serve Prometheus metrics and debug endpoints on (empty disables it).")
 
 	// Debugging flags
 	flag.BoolVar(&settings.DebugCPUProf, "debug-cpuprof", false, "[DEBUG] CPU Profiling")
@@ -267,26 +441,6 @@ func (settings *ScanSettings) InitFlags() {
 	settings.flagsSet = true
 }
 
-// Load settings from the first file found in searchPaths
-func (settings *ScanSettings) LoadFromDefaultConfigFiles() {
-	for _, path := range defaultConfigPaths {
-		if info, err := os.Stat(path); err == nil {
-			if info.IsDir() {
-				continue
-			}
-			settings.LoadFromConfigFile(path)
-			return
-		}
-	}
-}
-
-// Load from the specified file
-func (settings *ScanSettings) LoadFromConfigFile(path string) {
-	settings.InitFlags()
-	// TODO: load
-	settings.configPath = path
-}
-
 // Parse command line flags into settings
 func (settings *ScanSettings) ParseFlags() {
 	settings.InitFlags()
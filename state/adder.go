@@ -0,0 +1,44 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/workqueue"
+	"net/url"
+)
+
+// DedupingAdder wraps adder so that URLs already known to store (queued,
+// requested, or completed) in scope are silently dropped instead of
+// being re-added to the work queue.
+func DedupingAdder(store *Store, scope string, adder workqueue.QueueAddFunc) workqueue.QueueAddFunc {
+	return func(urls ...*url.URL) {
+		fresh := make([]*url.URL, 0, len(urls))
+		for _, u := range urls {
+			isNew, err := store.MarkQueued(scope, u.String())
+			if err != nil {
+				logging.Logf(logging.LogInfo, "Error recording queued URL %s: %s", u.String(), err.Error())
+				fresh = append(fresh, u)
+				continue
+			}
+			if isNew {
+				fresh = append(fresh, u)
+			}
+		}
+		if len(fresh) > 0 {
+			adder(fresh...)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+// DiffResult describes a URL whose response fingerprint differs between
+// two state databases.
+type DiffResult struct {
+	URL string
+	Old Fingerprint
+	New Fingerprint
+}
+
+// Diff opens oldPath and newPath and returns every URL completed in both
+// whose fingerprint changed between the two runs.  This is the basis for
+// --diff monitoring mode: re-scanning a target and reporting only what's
+// different since the last run.
+func Diff(oldPath, newPath string) ([]DiffResult, error) {
+	oldStore, err := Open(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	defer oldStore.Close()
+
+	newStore, err := Open(newPath)
+	if err != nil {
+		return nil, err
+	}
+	defer newStore.Close()
+
+	var oldRecs []URLRecord
+	query := oldStore.db.Select(q.Eq("Status", StatusCompleted))
+	if err := query.Find(&oldRecs); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	var diffs []DiffResult
+	for _, rec := range oldRecs {
+		oldFP := Fingerprint{
+			StatusCode:    rec.StatusCode,
+			ContentLength: rec.ContentLength,
+			BodyHash:      rec.BodyHash,
+		}
+		newFP, ok, err := newStore.Fingerprint(rec.URL)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if oldFP.Changed(newFP) {
+			diffs = append(diffs, DiffResult{URL: rec.URL, Old: oldFP, New: newFP})
+		}
+	}
+	return diffs, nil
+}
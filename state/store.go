@@ -0,0 +1,178 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package state persists crawl progress to an embedded database, so a
+// scan can skip work it already did, resume after an interruption, and
+// be diffed against a prior run to spot what changed.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"time"
+)
+
+// Status describes how far along a URL is in the crawl.
+type Status int
+
+const (
+	// StatusQueued means the URL has been added to the work queue but
+	// not yet requested.
+	StatusQueued Status = iota
+	// StatusRequested means a request for the URL is in flight.
+	StatusRequested
+	// StatusCompleted means a response was received and recorded.
+	StatusCompleted
+)
+
+// URLRecord is the persisted record for a single URL.
+type URLRecord struct {
+	URL           string `storm:"id"`
+	Scope         string `storm:"index"`
+	Status        Status `storm:"index"`
+	StatusCode    int
+	ContentLength int64
+	BodyHash      string
+	UpdatedAt     time.Time
+}
+
+// Fingerprint captures enough of a response to tell, on a later run,
+// whether it changed.
+type Fingerprint struct {
+	StatusCode    int
+	ContentLength int64
+	BodyHash      string
+}
+
+// Changed reports whether other differs from f in status, length, or body
+// hash.
+func (f Fingerprint) Changed(other Fingerprint) bool {
+	return f.StatusCode != other.StatusCode ||
+		f.ContentLength != other.ContentLength ||
+		f.BodyHash != other.BodyHash
+}
+
+// HashBody returns a short, stable fingerprint of a response body prefix.
+func HashBody(prefix []byte) string {
+	sum := sha256.Sum256(prefix)
+	return hex.EncodeToString(sum[:])
+}
+
+// Store is a handle on a scan's state database, built on BoltDB via the
+// Storm ORM layer.
+type Store struct {
+	db *storm.DB
+}
+
+// Open opens (creating if necessary) the state database at path.
+func Open(path string) (*Store, error) {
+	db, err := storm.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening state database %s: %s", path, err.Error())
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// MarkQueued records that rawURL has been added to the work queue for
+// scope.  It returns false if rawURL was already known (queued,
+// requested, or completed), so callers can skip re-adding duplicate work.
+func (s *Store) MarkQueued(scope, rawURL string) (bool, error) {
+	var existing URLRecord
+	err := s.db.One("URL", rawURL, &existing)
+	if err == nil {
+		return false, nil
+	}
+	if err != storm.ErrNotFound {
+		return false, err
+	}
+	rec := URLRecord{
+		URL:       rawURL,
+		Scope:     scope,
+		Status:    StatusQueued,
+		UpdatedAt: time.Now(),
+	}
+	if err := s.db.Save(&rec); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkRequested records that a request for rawURL is in flight.
+func (s *Store) MarkRequested(rawURL string) error {
+	var rec URLRecord
+	if err := s.db.One("URL", rawURL, &rec); err != nil {
+		return err
+	}
+	rec.Status = StatusRequested
+	rec.UpdatedAt = time.Now()
+	return s.db.Save(&rec)
+}
+
+// MarkCompleted records rawURL's response fingerprint.
+func (s *Store) MarkCompleted(rawURL string, fp Fingerprint) error {
+	var rec URLRecord
+	if err := s.db.One("URL", rawURL, &rec); err != nil {
+		rec = URLRecord{URL: rawURL}
+	}
+	rec.Status = StatusCompleted
+	rec.StatusCode = fp.StatusCode
+	rec.ContentLength = fp.ContentLength
+	rec.BodyHash = fp.BodyHash
+	rec.UpdatedAt = time.Now()
+	return s.db.Save(&rec)
+}
+
+// Fingerprint returns the recorded fingerprint for rawURL, if it has
+// completed.
+func (s *Store) Fingerprint(rawURL string) (Fingerprint, bool, error) {
+	var rec URLRecord
+	err := s.db.One("URL", rawURL, &rec)
+	if err == storm.ErrNotFound {
+		return Fingerprint{}, false, nil
+	}
+	if err != nil {
+		return Fingerprint{}, false, err
+	}
+	if rec.Status != StatusCompleted {
+		return Fingerprint{}, false, nil
+	}
+	return Fingerprint{
+		StatusCode:    rec.StatusCode,
+		ContentLength: rec.ContentLength,
+		BodyHash:      rec.BodyHash,
+	}, true, nil
+}
+
+// PendingURLs returns every URL recorded for scope that has not yet
+// completed, for requeuing when resuming an interrupted scan.
+func (s *Store) PendingURLs(scope string) ([]string, error) {
+	var recs []URLRecord
+	query := s.db.Select(q.Eq("Scope", scope), q.Not(q.Eq("Status", StatusCompleted)))
+	if err := query.Find(&recs); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	urls := make([]string, len(recs))
+	for i, r := range recs {
+		urls[i] = r.URL
+	}
+	return urls, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/settings"
+	"golang.org/x/net/html"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net/url"
+	"strings"
+)
+
+// BaselineProfile records, per HTTP status code, what a "not found"
+// response looks like for a scope, so TryURL can recognize and suppress
+// soft-404s: custom error pages or SPA shells that respond 200 OK to
+// everything.
+type BaselineProfile struct {
+	profiles         map[int]*baseline
+	hammingThreshold int
+	lengthTolerance  float64
+}
+
+type baseline struct {
+	contentLength int64
+	bodyHash      uint64
+	tagCounts     map[string]int
+}
+
+// NewBaselineProfile probes scope with settings.Soft404.Samples
+// deliberately nonexistent paths -- a random token, and the same token
+// with each of extensions appended -- recording one baseline response
+// per status code seen.  It returns nil if soft-404 detection is
+// disabled (settings.Soft404.Mode == settings.Soft404Off).
+func NewBaselineProfile(c client.Client, scope *url.URL, extensions []string, ss *settings.ScanSettings) *BaselineProfile {
+	if ss.Soft404.Mode == settings.Soft404Off {
+		return nil
+	}
+
+	profile := &BaselineProfile{
+		profiles:         map[int]*baseline{},
+		hammingThreshold: 3,
+		lengthTolerance:  0.05,
+	}
+	if ss.Soft404.Mode == settings.Soft404Strict {
+		profile.hammingThreshold = 1
+		profile.lengthTolerance = 0.01
+	}
+
+	for i := 0; i < ss.Soft404.Samples; i++ {
+		token := randomToken()
+		paths := make([]string, 0, len(extensions)+1)
+		paths = append(paths, "/"+token)
+		for _, ext := range extensions {
+			paths = append(paths, "/"+token+"."+ext)
+		}
+		for _, p := range paths {
+			u := *scope
+			u.Path = p
+			resp, err := c.Get(u.String())
+			if err != nil {
+				continue
+			}
+			body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBaselineBodyBytes))
+			resp.Body.Close()
+			if err != nil {
+				logging.Logf(logging.LogInfo, "Soft404 baseline: error reading %s: %s", u.String(), err.Error())
+				continue
+			}
+			profile.profiles[resp.StatusCode] = &baseline{
+				contentLength: int64(len(body)),
+				bodyHash:      simhash(normalizeBody(body, token)),
+				tagCounts:     domTagCounts(body),
+			}
+		}
+	}
+	return profile
+}
+
+// Detect reports whether a response with statusCode and body matches
+// this profile's baseline for that status code closely enough to be a
+// soft-404 rather than real content.
+func (p *BaselineProfile) Detect(statusCode int, body []byte) bool {
+	if p == nil {
+		return false
+	}
+	base, ok := p.profiles[statusCode]
+	if !ok {
+		return false
+	}
+	hash := simhash(normalizeBody(body, ""))
+	if hammingDistance(hash, base.bodyHash) > p.hammingThreshold {
+		return false
+	}
+	if !tagCountsSimilar(base.tagCounts, domTagCounts(body), p.lengthTolerance) {
+		return false
+	}
+	if base.contentLength == 0 {
+		return len(body) == 0
+	}
+	delta := len(body) - int(base.contentLength)
+	if delta < 0 {
+		delta = -delta
+	}
+	return float64(delta)/float64(base.contentLength) <= p.lengthTolerance
+}
+
+// tagCountsSimilar reports whether two DOM tag-count profiles are close
+// enough (total tag count differing by no more than tolerance) to be the
+// same template.
+func tagCountsSimilar(a, b map[string]int, tolerance float64) bool {
+	totalA, totalB := 0, 0
+	for _, n := range a {
+		totalA += n
+	}
+	for _, n := range b {
+		totalB += n
+	}
+	if totalA == 0 && totalB == 0 {
+		return true
+	}
+	if totalA == 0 || totalB == 0 {
+		return false
+	}
+	delta := totalA - totalB
+	if delta < 0 {
+		delta = -delta
+	}
+	return float64(delta)/float64(totalA) <= tolerance
+}
+
+const maxBaselineBodyBytes = 1024 * 1024
+
+// normalizeBody collapses each run of whitespace to a single space and
+// strips any occurrence of token (the
+// random probe string, when known) from body before hashing, so runs
+// differing only in the probed path still compare equal.
+func normalizeBody(body []byte, token string) []byte {
+	s := string(body)
+	if token != "" {
+		s = strings.ReplaceAll(s, token, "")
+	}
+	fields := strings.Fields(s)
+	return []byte(strings.Join(fields, " "))
+}
+
+// simhash computes a 64-bit SimHash over whitespace-separated shingles of
+// data, so near-duplicate documents hash close together under Hamming
+// distance.
+func simhash(data []byte) uint64 {
+	var weights [64]int
+	for _, word := range strings.Fields(string(data)) {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var result uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			result |= 1 << uint(bit)
+		}
+	}
+	return result
+}
+
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// domTagCounts returns how many times each HTML element name appears in
+// body, as an additional structural signal a caller may compare
+// alongside the body hash.
+func domTagCounts(body []byte) map[string]int {
+	counts := map[string]int{}
+	tree, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return counts
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			counts[strings.ToLower(n.Data)]++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(tree)
+	return counts
+}
+
+// randomToken returns a random lowercase alphanumeric string between 16
+// and 32 characters, for use as a deliberately-nonexistent path.
+func randomToken() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	n := 16 + randomIntn(17)
+	idx := make([]byte, n)
+	rand.Read(idx)
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[int(idx[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+func randomIntn(max int) int {
+	var buf [4]byte
+	rand.Read(buf[:])
+	return int(binary.BigEndian.Uint32(buf[:])) % max
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestProfile(body []byte) *BaselineProfile {
+	return &BaselineProfile{
+		profiles: map[int]*baseline{
+			200: {
+				contentLength: int64(len(body)),
+				bodyHash:      simhash(normalizeBody(body, "")),
+				tagCounts:     domTagCounts(body),
+			},
+		},
+		hammingThreshold: 3,
+		lengthTolerance:  0.05,
+	}
+}
+
+func TestBaselineProfile_Detect_NearDuplicate(t *testing.T) {
+	base := strings.Repeat("Sorry this page could not be found please try searching instead ", 6)
+	near := strings.Replace(base, "found", "located", 1)
+	profile := newTestProfile([]byte(base))
+	if !profile.Detect(200, []byte(near)) {
+		t.Error("Expected a near-duplicate soft-404 body to be detected")
+	}
+}
+
+func TestBaselineProfile_Detect_Different(t *testing.T) {
+	base := strings.Repeat("Sorry this page could not be found please try searching instead ", 6)
+	real := strings.Repeat("Quarterly report revenue grew twelve percent year over year ", 6)
+	profile := newTestProfile([]byte(base))
+	if profile.Detect(200, []byte(real)) {
+		t.Error("Expected unrelated real content not to be detected as a soft-404")
+	}
+}
+
+func TestBaselineProfile_Detect_UnknownStatus(t *testing.T) {
+	profile := newTestProfile([]byte("not found"))
+	if profile.Detect(404, []byte("not found")) {
+		t.Error("Expected no baseline for an unprofiled status code")
+	}
+}
@@ -15,27 +15,179 @@
 package worker
 
 import (
-	"github.com/Matir/gobuster/logging"
-	"github.com/Matir/gobuster/util"
-	"github.com/Matir/gobuster/workqueue"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/workqueue"
 	"golang.org/x/net/html"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
+// LinkExtractor pulls every URL-bearing string out of a document body.
+// Register one against a content type with RegisterLinkExtractor to
+// teach HTMLWorker how to find links in additional formats.
+type LinkExtractor interface {
+	ExtractLinks(body io.Reader) []string
+}
+
+// extractors maps a lowercased, parameter-stripped MIME type to the
+// LinkExtractor that understands it.  text/html, application/xhtml+xml,
+// and text/css are registered by default.
+var extractors = map[string]LinkExtractor{}
+
+func init() {
+	h := htmlLinkExtractor{}
+	extractors["text/html"] = h
+	extractors["application/xhtml+xml"] = h
+	extractors["text/css"] = cssLinkExtractor{}
+}
+
+// RegisterLinkExtractor registers extractor to handle contentType (e.g.
+// "application/json"), making HTMLWorker.Eligible accept responses of
+// that type and HTMLWorker.Handle dispatch to it.
+func RegisterLinkExtractor(contentType string, extractor LinkExtractor) {
+	extractors[strings.ToLower(contentType)] = extractor
+}
+
+// urlAttrs maps an element name to the attribute(s) on it that carry
+// URLs.
+var urlAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"script": {"src"},
+	"img":    {"src", "srcset"},
+	"iframe": {"src"},
+	"source": {"src", "srcset"},
+	"audio":  {"src"},
+	"video":  {"src"},
+	"embed":  {"src"},
+	"track":  {"src"},
+	"form":   {"action"},
+	"object": {"data"},
+}
+
+// cssURLPattern matches url(...) references in CSS, with or without
+// quotes.
+var cssURLPattern = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// metaRefreshURLPattern pulls the URL out of a <meta http-equiv="refresh"
+// content="N;url=..."> tag's content attribute.
+var metaRefreshURLPattern = regexp.MustCompile(`(?i)url\s*=\s*(.+)$`)
+
+// htmlLinkExtractor walks a parsed HTML (or XHTML) document once,
+// harvesting every URL-bearing attribute, meta-refresh target, and
+// inline CSS url(...) reference it finds.
+type htmlLinkExtractor struct{}
+
+func (htmlLinkExtractor) ExtractLinks(body io.Reader) []string {
+	tree, err := html.Parse(body)
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Unable to parse HTML document: %s", err.Error())
+		return nil
+	}
+	links := make([]string, 0)
+	var handleNode func(*html.Node)
+	handleNode = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			tag := strings.ToLower(node.Data)
+			attrs := make(map[string]string, len(node.Attr))
+			for _, a := range node.Attr {
+				attrs[strings.ToLower(a.Key)] = a.Val
+			}
+			for _, attr := range urlAttrs[tag] {
+				val, ok := attrs[attr]
+				if !ok {
+					continue
+				}
+				if attr == "srcset" {
+					links = append(links, parseSrcset(val)...)
+				} else {
+					links = append(links, val)
+				}
+			}
+			if tag == "meta" && strings.ToLower(attrs["http-equiv"]) == "refresh" {
+				if m := metaRefreshURLPattern.FindStringSubmatch(attrs["content"]); m != nil {
+					links = append(links, strings.TrimSpace(m[1]))
+				}
+			}
+			if style, ok := attrs["style"]; ok {
+				links = append(links, extractCSSURLs(style)...)
+			}
+			if tag == "style" && node.FirstChild != nil && node.FirstChild.Type == html.TextNode {
+				links = append(links, extractCSSURLs(node.FirstChild.Data)...)
+			}
+		}
+		for n := node.FirstChild; n != nil; n = n.NextSibling {
+			handleNode(n)
+		}
+	}
+	handleNode(tree)
+	return links
+}
+
+// parseSrcset splits a srcset attribute on commas and strips each
+// candidate's width/density descriptor, keeping just the URL.
+func parseSrcset(val string) []string {
+	var links []string
+	for _, candidate := range strings.Split(val, ",") {
+		fields := strings.Fields(strings.TrimSpace(candidate))
+		if len(fields) > 0 {
+			links = append(links, fields[0])
+		}
+	}
+	return links
+}
+
+// extractCSSURLs returns every url(...) reference in a CSS snippet.
+func extractCSSURLs(css string) []string {
+	var links []string
+	for _, m := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		links = append(links, strings.TrimSpace(m[1]))
+	}
+	return links
+}
+
+// cssLinkExtractor extracts url(...) references from a standalone CSS
+// document.
+type cssLinkExtractor struct{}
+
+func (cssLinkExtractor) ExtractLinks(body io.Reader) []string {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Unable to read CSS document: %s", err.Error())
+		return nil
+	}
+	return extractCSSURLs(string(data))
+}
+
+// DefaultMaxContentLength is used when a HTMLWorker is constructed
+// without an explicit content length cutoff.
+const DefaultMaxContentLength = 1024 * 1024
+
 type HTMLWorker struct {
 	// Function to add future work
 	adder workqueue.QueueAddFunc
+	// Largest response body this worker will parse for links.
+	maxContentLength int64
 }
 
-func NewHTMLWorker(adder workqueue.QueueAddFunc) *HTMLWorker {
-	return &HTMLWorker{adder: adder}
+// NewHTMLWorker constructs a HTMLWorker that feeds discovered URLs to
+// adder and refuses to parse bodies larger than maxContentLength (use 0
+// for DefaultMaxContentLength).
+func NewHTMLWorker(adder workqueue.QueueAddFunc, maxContentLength int64) *HTMLWorker {
+	if maxContentLength <= 0 {
+		maxContentLength = DefaultMaxContentLength
+	}
+	return &HTMLWorker{adder: adder, maxContentLength: maxContentLength}
 }
 
-func (w *HTMLWorker) Handle(URL *url.URL, body io.Reader) {
-	links := w.GetLinks(body)
+func (w *HTMLWorker) Handle(URL *url.URL, contentType string, body io.Reader) {
+	links := w.GetLinks(contentType, body)
 	foundURLs := make([]*url.URL, 0, len(links))
 	for _, l := range links {
 		u, err := url.Parse(l)
@@ -48,38 +200,30 @@ func (w *HTMLWorker) Handle(URL *url.URL, body io.Reader) {
 	w.adder(foundURLs...)
 }
 
-func (*HTMLWorker) Eligible(resp *http.Response) bool {
-	ct := resp.Header.Get("Content-type")
-	if strings.ToLower(ct) != "text/html" {
+// Eligible reports whether resp is a content type with a registered
+// LinkExtractor and within this worker's content length cutoff.
+func (w *HTMLWorker) Eligible(resp *http.Response) bool {
+	if _, ok := extractors[baseContentType(resp.Header.Get("Content-Type"))]; !ok {
 		return false
 	}
-	return resp.ContentLength > 0 && resp.ContentLength < 1024*1024
+	return resp.ContentLength > 0 && resp.ContentLength <= w.maxContentLength
 }
 
-func (*HTMLWorker) GetLinks(body io.Reader) []string {
-	tree, err := html.Parse(body)
-	if err != nil {
-		logging.Logf(logging.LogInfo, "Unable to parse HTML document: %s", err.Error())
+// GetLinks dispatches to the LinkExtractor registered for contentType and
+// returns the deduped set of links it finds.
+func (w *HTMLWorker) GetLinks(contentType string, body io.Reader) []string {
+	extractor, ok := extractors[baseContentType(contentType)]
+	if !ok {
 		return nil
 	}
-	links := make([]string, 0)
-	var handleNode func(*html.Node)
-	handleNode = func(node *html.Node) {
-		if node.Type == html.ElementNode {
-			if strings.ToLower(node.Data) == "a" {
-				for _, a := range node.Attr {
-					if strings.ToLower(a.Key) == "href" {
-						links = append(links, a.Val)
-						break
-					}
-				}
-			}
-		}
-		// Handle children
-		for n := node.FirstChild; n != nil; n = n.NextSibling {
-			handleNode(n)
-		}
+	return util.DedupeStrings(extractor.ExtractLinks(body))
+}
+
+// baseContentType strips any parameters (e.g. "; charset=utf-8") from a
+// Content-Type header value and lower-cases it for map lookups.
+func baseContentType(ct string) string {
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
 	}
-	handleNode(tree)
-	return util.DedupeStrings(links)
+	return strings.ToLower(strings.TrimSpace(ct))
 }
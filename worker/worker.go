@@ -0,0 +1,283 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/metrics"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/seeder"
+	"github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/state"
+	"github.com/Matir/webborer/workqueue"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// mangleExtensions is the built-in set of extensions used by the
+// package-level Mangle helper, independent of any particular scan's
+// configured settings.Spider.Extensions.
+var mangleExtensions = []string{"html", "php", "asp", "aspx"}
+
+// Worker requests URLs from src, reports what it finds on rchan, and
+// feeds newly-discovered URLs back through adder.
+type Worker struct {
+	client   client.Client
+	settings *settings.ScanSettings
+	src      chan *url.URL
+	adder    workqueue.QueueAddFunc
+	done     func(int)
+	rchan    chan results.Result
+	quit     chan struct{}
+
+	// scope identifies which scan scope this worker's URLs belong to,
+	// for state store bookkeeping.  Set with SetScope; empty is fine
+	// when state persistence isn't in use.
+	scope string
+	// store is the optional state database recording crawl progress,
+	// opened from settings.State.Path/ResumePath by NewWorker.
+	store *state.Store
+	// rules are the robots.txt rules to enforce when settings.Robots.Mode
+	// is ObeyRobots or SeedRobots, set with SetRobotsRules.
+	rules *seeder.Rules
+	// baseline is the soft-404 profile to compare responses against,
+	// set with SetBaseline.
+	baseline *BaselineProfile
+}
+
+// SetBaseline installs the soft-404 baseline profile (as produced by
+// NewBaselineProfile) that TryURL should compare responses against.
+func (w *Worker) SetBaseline(baseline *BaselineProfile) {
+	w.baseline = baseline
+}
+
+// SetRobotsRules installs the robots.txt rules (as produced by
+// seeder.Seed) that TryURL should enforce when settings.Robots.Mode is
+// ObeyRobots or SeedRobots.
+func (w *Worker) SetRobotsRules(rules *seeder.Rules) {
+	w.rules = rules
+}
+
+// NewWorker constructs a Worker that reads URLs from src, reports
+// completion via done, adds newly-found URLs via adder, and writes
+// results to rchan.  If settings.State.Path or settings.State.ResumePath
+// is set, it opens (or reopens) the state database so TryURL/HandleURL
+// can skip duplicate work and record progress.
+func NewWorker(ss *settings.ScanSettings, cf client.ClientFactory, src chan *url.URL, adder workqueue.QueueAddFunc, done func(int), rchan chan results.Result) *Worker {
+	adder = metrics.InstrumentAdder(adder)
+
+	w := &Worker{
+		client:   cf.Get(),
+		settings: ss,
+		src:      src,
+		adder:    adder,
+		done:     done,
+		rchan:    rchan,
+		quit:     make(chan struct{}),
+	}
+
+	statePath := ss.State.Path
+	if statePath == "" {
+		statePath = ss.State.ResumePath
+	}
+	if statePath != "" {
+		store, err := state.Open(statePath)
+		if err != nil {
+			logging.Logf(logging.LogError, "Unable to open state store %s: %s", statePath, err.Error())
+		} else {
+			w.store = store
+		}
+	}
+
+	return w
+}
+
+// SetScope records which scan scope this worker's URLs belong to, for
+// state store bookkeeping.  If a state store is configured, it also
+// (re)wraps adder in a DedupingAdder bound to that scope, since the
+// deduping key is only meaningful once the scope is known.
+func (w *Worker) SetScope(scope string) {
+	w.scope = scope
+	if w.store != nil {
+		w.adder = state.DedupingAdder(w.store, scope, w.adder)
+	}
+}
+
+// StartWorkers creates and starts settings.Network.Workers Worker
+// instances, each running in its own goroutine reading from src, and
+// returns them so the caller can Stop them later.  If ss.MetricsAddr is
+// set, it also starts a metrics.Server on that address; it runs for the
+// lifetime of the process, as there is no corresponding StopWorkers to
+// shut it down from.
+func StartWorkers(ss *settings.ScanSettings, cf client.ClientFactory, src chan *url.URL, adder workqueue.QueueAddFunc, done func(int), rchan chan results.Result) []*Worker {
+	if ss.MetricsAddr != "" {
+		if err := metrics.NewServer(ss.MetricsAddr).Start(); err != nil {
+			logging.Logf(logging.LogError, "Unable to start metrics server on %s: %s", ss.MetricsAddr, err.Error())
+		}
+	}
+
+	workers := make([]*Worker, ss.Network.Workers)
+	for i := range workers {
+		w := NewWorker(ss, cf, src, adder, done, rchan)
+		workers[i] = w
+		go w.Run()
+	}
+	return workers
+}
+
+// Run is a Worker's main loop, handling URLs from src until Stop is
+// called or src is closed.
+func (w *Worker) Run() {
+	for {
+		select {
+		case <-w.quit:
+			return
+		case u, ok := <-w.src:
+			if !ok {
+				return
+			}
+			metrics.QueueChanged(-1)
+			w.HandleURL(u)
+		}
+	}
+}
+
+// Stop signals the Worker to exit after any URL it is currently handling.
+func (w *Worker) Stop() {
+	close(w.quit)
+}
+
+// HandleURL tries URL as given, then, if mangling is enabled, tries it
+// again with each configured extension appended, and finally reports
+// completion via done.
+func (w *Worker) HandleURL(URL *url.URL) {
+	w.TryURL(URL)
+	if w.settings.Spider.Mangle {
+		w.TryMangleURL(URL)
+	}
+	if w.done != nil {
+		w.done(1)
+	}
+}
+
+// TryMangleURL calls TryURL for every mangled variant of URL's path,
+// using the scan's configured extensions.
+func (w *Worker) TryMangleURL(URL *url.URL) {
+	for _, mangled := range MangleWithExtensions(URL.Path, w.settings.Spider.Extensions) {
+		u := *URL
+		u.Path = mangled
+		w.TryURL(&u)
+	}
+}
+
+// TryURL requests URL, reports the result on rchan, and, if the response
+// code is in settings.Spider.SpiderCodes and HTML parsing is enabled,
+// hands the body to an HTMLWorker to discover more links.  If a state
+// store is configured, already-completed URLs are skipped, and progress
+// is recorded as the request proceeds.
+func (w *Worker) TryURL(URL *url.URL) {
+	if w.settings.Robots.Mode != settings.IgnoreRobots && !w.rules.Allowed(URL.Path) {
+		logging.Logf(logging.LogDebug, "Skipping %s: disallowed by robots.txt", URL.String())
+		return
+	}
+
+	rawURL := URL.String()
+
+	if w.store != nil {
+		if _, done, err := w.store.Fingerprint(rawURL); err != nil {
+			logging.Logf(logging.LogInfo, "Error reading state for %s: %s", rawURL, err.Error())
+		} else if done {
+			return
+		}
+		if err := w.store.MarkRequested(rawURL); err != nil {
+			logging.Logf(logging.LogInfo, "Error recording request for %s: %s", rawURL, err.Error())
+		}
+	}
+
+	finishRequest := metrics.RequestStarted()
+
+	resp, err := w.client.Get(rawURL)
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Error fetching %s: %s", rawURL, err.Error())
+		metrics.RecordError(w.scope)
+		finishRequest(0, 0)
+		return
+	}
+	defer resp.Body.Close()
+
+	hw := NewHTMLWorker(w.adder, w.settings.Spider.MaxContentLength)
+	eligible := hw.Eligible(resp)
+
+	var body []byte
+	var soft404 bool
+	if w.baseline != nil || eligible {
+		body, err = ioutil.ReadAll(io.LimitReader(resp.Body, hw.maxContentLength))
+		if err != nil {
+			logging.Logf(logging.LogInfo, "Error reading body for %s: %s", rawURL, err.Error())
+		}
+	}
+	finishRequest(resp.StatusCode, int64(len(body)))
+	if w.baseline != nil {
+		soft404 = w.baseline.Detect(resp.StatusCode, body)
+	}
+
+	result := results.Result{URL: URL, Code: resp.StatusCode, Soft404: soft404}
+	w.rchan <- result
+
+	if w.store != nil {
+		fp := state.Fingerprint{StatusCode: resp.StatusCode, ContentLength: int64(len(body)), BodyHash: state.HashBody(body)}
+		if err := w.store.MarkCompleted(rawURL, fp); err != nil {
+			logging.Logf(logging.LogInfo, "Error recording completion for %s: %s", rawURL, err.Error())
+		}
+	}
+
+	if soft404 || !w.settings.Spider.ParseHTML || !spiderable(w.settings.Spider.SpiderCodes, resp.StatusCode) {
+		return
+	}
+	if eligible {
+		hw.Handle(URL, resp.Header.Get("Content-Type"), bytes.NewReader(body))
+	}
+}
+
+func spiderable(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Mangle returns base with each of the built-in mangle extensions
+// appended, e.g. "foo" -> ["foo.html", "foo.php", "foo.asp", "foo.aspx"].
+// Use MangleWithExtensions to mangle with a scan's configured extension
+// list instead.
+func Mangle(base string) []string {
+	return MangleWithExtensions(base, mangleExtensions)
+}
+
+// MangleWithExtensions returns base with each of extensions appended.
+func MangleWithExtensions(base string, extensions []string) []string {
+	base = strings.TrimSuffix(base, "/")
+	mangled := make([]string, 0, len(extensions))
+	for _, ext := range extensions {
+		mangled = append(mangled, base+"."+ext)
+	}
+	return mangled
+}
@@ -43,7 +43,7 @@ func TryURLHelper(u *url.URL, resp *http.Response) *Worker {
 		client.NextResponse = resp
 	}
 	ss := &settings.ScanSettings{
-		SpiderCodes: []int{200},
+		Spider: settings.SpiderSettings{SpiderCodes: []int{200}},
 	}
 	rchan := make(chan results.Result)
 	w := &Worker{
@@ -81,8 +81,10 @@ func TestTryMangleURL_Basic(t *testing.T) {
 		ForeverResponse: resp,
 	}
 	ss := &settings.ScanSettings{
-		SpiderCodes: []int{200},
-		Mangle:      true,
+		Spider: settings.SpiderSettings{
+			SpiderCodes: []int{200},
+			Mangle:      true,
+		},
 	}
 	rchan := make(chan results.Result)
 	go func() {
@@ -107,9 +109,11 @@ func TestTryHandleURL_Basic(t *testing.T) {
 		ForeverResponse: resp,
 	}
 	ss := &settings.ScanSettings{
-		SpiderCodes: []int{200},
-		Mangle:      true,
-		Extensions:  []string{"html", "php"},
+		Spider: settings.SpiderSettings{
+			SpiderCodes: []int{200},
+			Mangle:      true,
+			Extensions:  []string{"html", "php"},
+		},
 	}
 	rchan := make(chan results.Result)
 	go func() {
@@ -130,7 +134,7 @@ func TestTryHandleURL_Basic(t *testing.T) {
 
 func TestStartWorkers_Single(t *testing.T) {
 	ss := &settings.ScanSettings{
-		Workers: 1,
+		Network: settings.NetworkSettings{Workers: 1},
 	}
 	schan := make(chan *url.URL)
 	rchan := make(chan results.Result)